@@ -0,0 +1,148 @@
+package blobstore
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Format identifies an archive's container and/or compression scheme.
+type Format string
+
+// Supported archive formats. FormatTar is a bare, uncompressed tar stream;
+// the others layer a compression codec (or, for zip/rar, their own native
+// container) on top.
+const (
+	FormatTar     Format = "tar"
+	FormatTarGz   Format = "tar.gz"
+	FormatTarZstd Format = "tar.zst"
+	FormatTarXz   Format = "tar.xz"
+	FormatZip     Format = "zip"
+	FormatRar     Format = "rar"
+)
+
+// Archiver packs a directory into an archive, unpacks one back onto disk,
+// and recognizes its own format from a stream's leading bytes. Concrete
+// implementations are registered in archivers and looked up with
+// ArchiverFor or DetectFormat, so callers rarely need to name a concrete
+// type directly.
+type Archiver interface {
+	// Archive writes the contents of src into w, in the receiver's format.
+	Archive(src string, w io.Writer) error
+
+	// Extract reads an archive in the receiver's format from r, recreating
+	// its contents under dst.
+	Extract(dst string, r io.Reader) error
+
+	// Identify reports whether the data in r begins with this format's
+	// magic bytes. Like DetectFormat, it only peeks: the returned io.Reader
+	// carries the bytes it peeked and must be used in place of r for any
+	// further reading, since r itself may be non-seekable and have already
+	// had those bytes drained from it.
+	Identify(r io.Reader) (Format, io.Reader, error)
+}
+
+// archivers maps each known Format to the Archiver that implements it.
+var archivers = map[Format]Archiver{
+	FormatTar:     tarArchiver{},
+	FormatTarGz:   targzArchiver{},
+	FormatTarZstd: tarzstdArchiver{},
+	FormatTarXz:   tarxzArchiver{},
+	FormatZip:     zipArchiver{},
+	FormatRar:     rarArchiver{},
+}
+
+// ArchiverFor returns the Archiver registered for format, or an error if no
+// archiver has been registered for it.
+func ArchiverFor(format Format) (Archiver, error) {
+	a, ok := archivers[format]
+	if !ok {
+		return nil, errors.Errorf("blobstore: no archiver registered for format %q", format)
+	}
+	return a, nil
+}
+
+// magic holds the leading bytes that identify each compressed/containerized
+// format. Order matters only in that longer, more specific magics should be
+// checked before shorter ones could coincidentally match; none currently
+// overlap.
+var magic = []struct {
+	format Format
+	bytes  []byte
+}{
+	{FormatTarGz, []byte{0x1f, 0x8b}},
+	{FormatTarZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{FormatTarXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{FormatZip, []byte{'P', 'K', 0x03, 0x04}},
+	{FormatRar, []byte{'R', 'a', 'r', '!', 0x1a, 0x07, 0x00}},
+}
+
+// tarMagicOffset and tarMagic locate the "ustar" marker that (almost) every
+// tar implementation writes into each header, which is the closest thing a
+// bare tar stream has to a magic number.
+const tarMagicOffset = 257
+
+var tarMagic = []byte("ustar")
+
+// DetectFormat peeks at the leading bytes of r and reports which registered
+// Format they match, without consuming them. A bare tar stream has no magic
+// at offset 0, so it is only reported once every compressed/containerized
+// format above has been ruled out.
+func DetectFormat(r io.Reader) (Format, *bufio.Reader, error) {
+	br := bufio.NewReaderSize(r, tarMagicOffset+len(tarMagic))
+
+	for _, m := range magic {
+		head, err := br.Peek(len(m.bytes))
+		if err != nil && err != io.EOF {
+			return "", br, errors.Wrap(err, "blobstore: could not peek archive header")
+		}
+		if bytes.Equal(head, m.bytes) {
+			return m.format, br, nil
+		}
+	}
+
+	head, err := br.Peek(tarMagicOffset + len(tarMagic))
+	if err != nil && err != io.EOF {
+		return "", br, errors.Wrap(err, "blobstore: could not peek archive header")
+	}
+	if len(head) >= tarMagicOffset+len(tarMagic) && bytes.Equal(head[tarMagicOffset:tarMagicOffset+len(tarMagic)], tarMagic) {
+		return FormatTar, br, nil
+	}
+
+	return "", br, errors.New("blobstore: unrecognized archive format")
+}
+
+// Extract auto-detects the archive format from r's magic bytes and extracts
+// it under dst, so callers no longer need to hard-code a format (e.g. a
+// trailing ".gz") to know how to unpack a downloaded blob.
+func Extract(dst string, r io.Reader) error {
+	format, br, err := DetectFormat(r)
+	if err != nil {
+		return err
+	}
+
+	a, err := ArchiverFor(format)
+	if err != nil {
+		return err
+	}
+
+	return a.Extract(dst, br)
+}
+
+// identify is the shared implementation behind each concrete Archiver's
+// Identify method: it detects the format of r and reports an error unless
+// it matches want. It returns br, the buffered reader DetectFormat peeked
+// from, so the caller continues reading from br rather than the now
+// partially-drained r.
+func identify(r io.Reader, want Format) (Format, io.Reader, error) {
+	format, br, err := DetectFormat(r)
+	if err != nil {
+		return "", br, err
+	}
+	if format != want {
+		return "", br, errors.Errorf("blobstore: stream is %q, not %q", format, want)
+	}
+	return format, br, nil
+}
@@ -0,0 +1,69 @@
+package blobstore
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/nwaples/rardecode"
+	"github.com/pkg/errors"
+)
+
+// rarArchiver implements Archiver for the rar format. rar is read-only
+// here: there is no actively maintained pure-Go rar encoder, so Archive
+// always fails rather than silently writing something else.
+type rarArchiver struct{}
+
+func (rarArchiver) Archive(src string, w io.Writer) error {
+	return errors.New("blobstore: rar archive creation is not supported, rar is read-only")
+}
+
+func (rarArchiver) Extract(dst string, r io.Reader) error {
+	rr, err := rardecode.NewReader(r, "")
+	if err != nil {
+		return errors.Wrap(err, "blobstore: could not open rar reader")
+	}
+
+	copyBuffer := make([]byte, 32*1024)
+
+	for {
+		header, err := rr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "blobstore: could not read rar header")
+		}
+
+		target, err := sanitizeExtractPath(dst, header.Name)
+		if err != nil {
+			return err
+		}
+
+		if header.IsDir {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_RDWR, header.Mode())
+		if err != nil {
+			return err
+		}
+
+		_, err = io.CopyBuffer(f, rr, copyBuffer)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (rarArchiver) Identify(r io.Reader) (Format, io.Reader, error) {
+	return identify(r, FormatRar)
+}
@@ -0,0 +1,44 @@
+package blobstore
+
+import (
+	"archive/tar"
+	"io"
+
+	"github.com/klauspost/pgzip"
+)
+
+// tarArchiver implements Archiver for a bare, uncompressed tar stream.
+type tarArchiver struct{}
+
+func (tarArchiver) Archive(src string, w io.Writer) error {
+	return TarDir(src, w)
+}
+
+func (tarArchiver) Extract(dst string, r io.Reader) error {
+	return untar(dst, tar.NewReader(r))
+}
+
+func (tarArchiver) Identify(r io.Reader) (Format, io.Reader, error) {
+	return identify(r, FormatTar)
+}
+
+// targzArchiver implements Archiver for gzip-compressed tar, the format
+// blobs have always used.
+type targzArchiver struct{}
+
+func (targzArchiver) Archive(src string, w io.Writer) error {
+	gw := pgzip.NewWriter(w)
+	if err := TarDir(src, gw); err != nil {
+		gw.Close()
+		return err
+	}
+	return gw.Close()
+}
+
+func (targzArchiver) Extract(dst string, r io.Reader) error {
+	return Untargz(dst, r)
+}
+
+func (targzArchiver) Identify(r io.Reader) (Format, io.Reader, error) {
+	return identify(r, FormatTarGz)
+}
@@ -0,0 +1,37 @@
+package blobstore
+
+import (
+	"archive/tar"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+)
+
+// tarxzArchiver implements Archiver for xz-compressed tar.
+type tarxzArchiver struct{}
+
+func (tarxzArchiver) Archive(src string, w io.Writer) error {
+	xw, err := xz.NewWriter(w)
+	if err != nil {
+		return errors.Wrap(err, "blobstore: could not open xz writer")
+	}
+	if err := TarDir(src, xw); err != nil {
+		xw.Close()
+		return err
+	}
+	return xw.Close()
+}
+
+func (tarxzArchiver) Extract(dst string, r io.Reader) error {
+	xr, err := xz.NewReader(r)
+	if err != nil {
+		return errors.Wrap(err, "blobstore: could not open xz reader")
+	}
+
+	return untar(dst, tar.NewReader(xr))
+}
+
+func (tarxzArchiver) Identify(r io.Reader) (Format, io.Reader, error) {
+	return identify(r, FormatTarXz)
+}
@@ -0,0 +1,135 @@
+package blobstore
+
+import (
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// zipArchiver implements Archiver for the zip format.
+type zipArchiver struct{}
+
+func (zipArchiver) Archive(src string, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	defer zw.Close()
+
+	copyBuffer := make([]byte, 32*1024)
+
+	return filepath.Walk(src, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return err
+		}
+		header.Name = strings.TrimPrefix(strings.Replace(file, src, "", -1), string(filepath.Separator))
+		header.Method = zip.Deflate
+		header.Modified = time.Time{}
+
+		if fi.IsDir() {
+			header.Name += "/"
+		}
+
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.CopyBuffer(fw, f, copyBuffer)
+		return err
+	})
+}
+
+func (zipArchiver) Extract(dst string, r io.Reader) error {
+	// zip.NewReader needs an io.ReaderAt, which a plain io.Reader isn't, so
+	// spool the stream to a temporary file first.
+	tmp, err := ioutil.TempFile("", "blobstore-zip")
+	if err != nil {
+		return errors.Wrap(err, "blobstore: could not create temporary zip file")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return errors.Wrap(err, "blobstore: could not buffer zip stream")
+	}
+
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return errors.Wrap(err, "blobstore: could not open zip reader")
+	}
+
+	copyBuffer := make([]byte, 32*1024)
+
+	for _, f := range zr.File {
+		target, err := sanitizeExtractPath(dst, f.Name)
+		if err != nil {
+			return err
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_RDWR, f.Mode())
+		if err != nil {
+			rc.Close()
+			return err
+		}
+
+		_, err = io.CopyBuffer(out, rc, copyBuffer)
+		rc.Close()
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (zipArchiver) Identify(r io.Reader) (Format, io.Reader, error) {
+	return identify(r, FormatZip)
+}
+
+// sanitizeExtractPath joins name onto dst and guards against zip-slip: an
+// archive entry whose name escapes dst via ".." or an absolute path.
+func sanitizeExtractPath(dst, name string) (string, error) {
+	dst = filepath.Clean(dst)
+	target := filepath.Join(dst, name)
+	if target != dst && !strings.HasPrefix(target, dst+string(filepath.Separator)) {
+		return "", errors.Errorf("blobstore: archive entry %q escapes destination %q", name, dst)
+	}
+	return target, nil
+}
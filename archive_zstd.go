@@ -0,0 +1,38 @@
+package blobstore
+
+import (
+	"archive/tar"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// tarzstdArchiver implements Archiver for zstd-compressed tar.
+type tarzstdArchiver struct{}
+
+func (tarzstdArchiver) Archive(src string, w io.Writer) error {
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return errors.Wrap(err, "blobstore: could not open zstd writer")
+	}
+	if err := TarDir(src, zw); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+func (tarzstdArchiver) Extract(dst string, r io.Reader) error {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return errors.Wrap(err, "blobstore: could not open zstd reader")
+	}
+	defer zr.Close()
+
+	return untar(dst, tar.NewReader(zr))
+}
+
+func (tarzstdArchiver) Identify(r io.Reader) (Format, io.Reader, error) {
+	return identify(r, FormatTarZstd)
+}
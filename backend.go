@@ -0,0 +1,64 @@
+package blobstore
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ObjectInfo describes a stored object, as reported by Backend.Stat.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	ContentType  string
+	LastModified time.Time
+}
+
+// FileWriter is a resumable, offset-based upload in progress. It is
+// modeled after the docker/distribution storagedriver.FileWriter pattern:
+// callers Write contiguously, Close to pause the upload (what's written so
+// far is kept, so a later Writer call for the same key resumes from
+// Size()), Cancel to discard it entirely, or Commit to finalize it as a
+// complete object.
+type FileWriter interface {
+	io.Writer
+
+	// Size reports how many bytes have been written so far.
+	Size() int64
+
+	// Close pauses the upload without finalizing or discarding it.
+	Close() error
+
+	// Cancel aborts the upload, discarding anything written so far.
+	Cancel(ctx context.Context) error
+
+	// Commit finalizes the upload, making it visible as a complete
+	// object under its key.
+	Commit(ctx context.Context) error
+}
+
+// Backend is a pluggable object store - S3, local filesystem, SFTP, or an
+// in-memory store for tests. BlobStore builds all of its higher-level blob
+// logic (dedup, chunked upload/download) on top of this minimal surface,
+// so callers can swap storage without touching that logic.
+type Backend interface {
+	// Put uploads size bytes read from r to key, all at once.
+	Put(ctx context.Context, key string, r io.Reader, size int64, metadata map[string]string) error
+
+	// Get opens a ranged read of key, starting at offset and reading up
+	// to length bytes. length <= 0 means "to the end of the object".
+	Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+
+	// Stat reports metadata about key, or an error if it doesn't exist.
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+
+	// Delete removes key. Deleting a key that doesn't exist is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+
+	// Writer opens a resumable upload to key. If an earlier upload to
+	// key was started and neither Committed nor Cancelled, the returned
+	// FileWriter resumes from where that upload left off.
+	Writer(ctx context.Context, key string) (FileWriter, error)
+}
@@ -0,0 +1,161 @@
+package blobstore
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// LocalBackend is a Backend storing objects as plain files under a root
+// directory on the local filesystem. It's useful for running a BlobStore
+// against a disk or network share without an S3-compatible endpoint in
+// front of it.
+type LocalBackend struct {
+	Root string
+}
+
+// NewLocalBackend returns a Backend rooted at root, creating it if it
+// doesn't already exist.
+func NewLocalBackend(root string) (*LocalBackend, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, errors.Wrapf(err, "Could not create backend root %q", root)
+	}
+	return &LocalBackend{Root: root}, nil
+}
+
+func (l *LocalBackend) path(key string) string {
+	return filepath.Join(l.Root, filepath.FromSlash(key))
+}
+
+func (l *LocalBackend) partPath(key string) string {
+	return l.path(key) + ".part"
+}
+
+// Put uploads size bytes read from r to key, all at once. metadata is
+// ignored: the local filesystem has nowhere natural to keep it.
+func (l *LocalBackend) Put(ctx context.Context, key string, r io.Reader, size int64, metadata map[string]string) error {
+	target := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	tmp := target + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return errors.Wrapf(err, "Error while writing %q", key)
+	}
+	f.Close()
+
+	return os.Rename(tmp, target)
+}
+
+// Get opens a ranged read of key. length <= 0 means "to the end".
+func (l *LocalBackend) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(l.path(key))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error while opening %q", key)
+	}
+
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	if length <= 0 {
+		return f, nil
+	}
+	return limitedReadCloser{io.LimitReader(f, length), f}, nil
+}
+
+// limitedReadCloser pairs an io.Reader (typically an io.LimitReader) with
+// the io.Closer of the underlying file it reads from.
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Stat reports metadata about key.
+func (l *LocalBackend) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	fi, err := os.Stat(l.path(key))
+	if err != nil {
+		return ObjectInfo{}, errors.Wrapf(err, "Error while stat'ing %q", key)
+	}
+	return ObjectInfo{Key: key, Size: fi.Size(), LastModified: fi.ModTime()}, nil
+}
+
+// Delete removes key.
+func (l *LocalBackend) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(l.path(key)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Error while deleting %q", key)
+	}
+	return nil
+}
+
+// Writer opens a resumable upload to key, appending to a ".part" file; a
+// later Writer call for the same key picks up from where that file left
+// off.
+func (l *LocalBackend) Writer(ctx context.Context, key string) (FileWriter, error) {
+	target := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(l.partPath(key), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error while opening %q for writing", key)
+	}
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &localWriter{backend: l, key: key, f: f, size: size}, nil
+}
+
+// localWriter implements FileWriter for LocalBackend.
+type localWriter struct {
+	backend *LocalBackend
+	key     string
+	f       *os.File
+	size    int64
+}
+
+func (w *localWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *localWriter) Size() int64 { return w.size }
+
+func (w *localWriter) Close() error {
+	return w.f.Close()
+}
+
+func (w *localWriter) Cancel(ctx context.Context) error {
+	w.f.Close()
+	if err := os.Remove(w.backend.partPath(w.key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (w *localWriter) Commit(ctx context.Context) error {
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(w.backend.partPath(w.key), w.backend.path(w.key))
+}
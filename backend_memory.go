@@ -0,0 +1,128 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MemoryBackend is an in-memory Backend. It implements the full Backend
+// interface without touching disk or network, which makes it a convenient
+// stand-in for S3Backend/LocalBackend/SFTPBackend in tests.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	pending map[string][]byte
+}
+
+// NewMemoryBackend returns an empty in-memory Backend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		objects: make(map[string][]byte),
+		pending: make(map[string][]byte),
+	}
+}
+
+// Put uploads size bytes read from r to key, all at once. metadata is
+// discarded: MemoryBackend has no metadata store.
+func (m *MemoryBackend) Put(ctx context.Context, key string, r io.Reader, size int64, metadata map[string]string) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = data
+	return nil
+}
+
+// Get opens a ranged read of key. length <= 0 means "to the end".
+func (m *MemoryBackend) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	m.mu.Lock()
+	data, ok := m.objects[key]
+	m.mu.Unlock()
+	if !ok {
+		return nil, errors.Errorf("blobstore: %q does not exist", key)
+	}
+
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length > 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Stat reports metadata about key.
+func (m *MemoryBackend) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	m.mu.Lock()
+	data, ok := m.objects[key]
+	m.mu.Unlock()
+	if !ok {
+		return ObjectInfo{}, errors.Errorf("blobstore: %q does not exist", key)
+	}
+	return ObjectInfo{Key: key, Size: int64(len(data)), LastModified: time.Time{}}, nil
+}
+
+// Delete removes key.
+func (m *MemoryBackend) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+// Writer opens a resumable upload to key, resuming any bytes buffered by
+// an earlier Writer that was Closed (paused) rather than Committed or
+// Cancelled.
+func (m *MemoryBackend) Writer(ctx context.Context, key string) (FileWriter, error) {
+	m.mu.Lock()
+	buf := append([]byte{}, m.pending[key]...)
+	m.mu.Unlock()
+	return &memoryWriter{backend: m, key: key, buf: buf}, nil
+}
+
+// memoryWriter implements FileWriter for MemoryBackend.
+type memoryWriter struct {
+	backend *MemoryBackend
+	key     string
+	buf     []byte
+}
+
+func (w *memoryWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+func (w *memoryWriter) Size() int64 { return int64(len(w.buf)) }
+
+func (w *memoryWriter) Close() error {
+	w.backend.mu.Lock()
+	defer w.backend.mu.Unlock()
+	w.backend.pending[w.key] = w.buf
+	return nil
+}
+
+func (w *memoryWriter) Cancel(ctx context.Context) error {
+	w.backend.mu.Lock()
+	defer w.backend.mu.Unlock()
+	delete(w.backend.pending, w.key)
+	return nil
+}
+
+func (w *memoryWriter) Commit(ctx context.Context) error {
+	w.backend.mu.Lock()
+	defer w.backend.mu.Unlock()
+	w.backend.objects[w.key] = w.buf
+	delete(w.backend.pending, w.key)
+	return nil
+}
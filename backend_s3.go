@@ -0,0 +1,347 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	minio "github.com/minio/minio-go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultPartSize is the size of each multipart upload part, used
+	// unless S3Config.PartSize is set.
+	DefaultPartSize = 64 * 1024 * 1024
+
+	// DefaultPartRetryElapsed bounds how long a single part is retried
+	// with backoff before giving up, unless S3Config.PartRetryElapsed is
+	// set.
+	DefaultPartRetryElapsed = time.Minute
+
+	// DefaultUploadTimeout bounds a whole multipart upload (all parts,
+	// including retries), unless S3Config.UploadTimeout is set.
+	DefaultUploadTimeout = 2 * time.Hour
+)
+
+// S3Config contains the configuration for an S3 Backend.
+type S3Config struct {
+	Key      string
+	Secret   string
+	Location string
+	Bucket   string
+	Endpoint string
+	SSL      bool
+
+	// JournalDir is where in-progress multipart upload journals are
+	// kept, so a Writer for the same key can resume after a crash.
+	// Defaults to os.TempDir() if empty.
+	JournalDir string
+
+	// PartSize overrides DefaultPartSize.
+	PartSize int64
+
+	// PartRetryElapsed overrides DefaultPartRetryElapsed.
+	PartRetryElapsed time.Duration
+
+	// UploadTimeout overrides DefaultUploadTimeout.
+	UploadTimeout time.Duration
+}
+
+// S3Backend is a Backend wrapping an S3 compatible storage.
+type S3Backend struct {
+	config *S3Config
+	client *minio.Client
+}
+
+// NewS3Backend returns a new S3 Backend.
+func NewS3Backend(config *S3Config) *S3Backend {
+	return &S3Backend{
+		config: config,
+	}
+}
+
+func (s3 *S3Backend) getClient() *minio.Client {
+	if s3.client != nil {
+		return s3.client
+	}
+
+	client, err := minio.New(
+		s3.config.Endpoint,
+		s3.config.Key,
+		s3.config.Secret,
+		s3.config.SSL)
+	if err != nil {
+		panic(err)
+	}
+
+	s3.client = client
+	return client
+}
+
+func (s3 *S3Backend) journalDir() string {
+	if s3.config.JournalDir != "" {
+		return s3.config.JournalDir
+	}
+	return os.TempDir()
+}
+
+func (s3 *S3Backend) partSize() int64 {
+	if s3.config.PartSize > 0 {
+		return s3.config.PartSize
+	}
+	return DefaultPartSize
+}
+
+func (s3 *S3Backend) partRetryElapsed() time.Duration {
+	if s3.config.PartRetryElapsed > 0 {
+		return s3.config.PartRetryElapsed
+	}
+	return DefaultPartRetryElapsed
+}
+
+func (s3 *S3Backend) uploadTimeout() time.Duration {
+	if s3.config.UploadTimeout > 0 {
+		return s3.config.UploadTimeout
+	}
+	return DefaultUploadTimeout
+}
+
+// Put uploads size bytes read from r to key, all at once.
+func (s3 *S3Backend) Put(ctx context.Context, key string, r io.Reader, size int64, metadata map[string]string) error {
+	_, err := s3.getClient().PutObject(s3.config.Bucket, key, r, size, minio.PutObjectOptions{
+		UserMetadata: metadata,
+	})
+	return errors.Wrapf(err, "Error while uploading %q", key)
+}
+
+// Get opens a ranged read of key. length <= 0 means "to the end".
+func (s3 *S3Backend) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if offset != 0 || length > 0 {
+		end := int64(0)
+		if length > 0 {
+			end = offset + length - 1
+		}
+		if err := opts.SetRange(offset, end); err != nil {
+			return nil, errors.Wrap(err, "Error while setting range")
+		}
+	}
+
+	obj, err := s3.getClient().GetObject(s3.config.Bucket, key, opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error while fetching %q", key)
+	}
+	return obj, nil
+}
+
+// Stat reports metadata about key.
+func (s3 *S3Backend) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := s3.getClient().StatObject(s3.config.Bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, errors.Wrapf(err, "Error while stat'ing %q", key)
+	}
+
+	return ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ETag:         info.ETag,
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+// Delete removes key.
+func (s3 *S3Backend) Delete(ctx context.Context, key string) error {
+	if err := s3.getClient().RemoveObject(s3.config.Bucket, key); err != nil {
+		return errors.Wrapf(err, "Error while deleting %q", key)
+	}
+	return nil
+}
+
+// Writer opens a resumable multipart upload to key. Each part is retried
+// with exponential backoff on transient errors, and the upload ID plus
+// completed part ETags are journaled to disk, so a new Writer for the same
+// key after a crash resumes from the last successfully uploaded part.
+func (s3 *S3Backend) Writer(ctx context.Context, key string) (FileWriter, error) {
+	core := &minio.Core{Client: s3.getClient()}
+	jPath := journalPath(s3.journalDir(), key)
+
+	journal, err := loadJournal(jPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if journal != nil {
+		// the journaled upload may already be gone server-side (e.g. a
+		// bucket lifecycle rule aborting incomplete multipart uploads
+		// after N days); resuming a dead upload ID would fail every part
+		// forever with no way to recover short of deleting the journal by
+		// hand, so verify it's still live before trusting it.
+		if _, err := core.ListObjectParts(s3.config.Bucket, key, journal.UploadID, 0, 1); err != nil {
+			if !isNoSuchUploadError(err) {
+				return nil, errors.Wrap(err, "Error while checking resumable upload")
+			}
+			journal = nil
+		}
+	}
+
+	if journal == nil {
+		uploadID, err := core.NewMultipartUpload(s3.config.Bucket, key, minio.PutObjectOptions{})
+		if err != nil {
+			return nil, errors.Wrap(err, "Error while initiating multipart upload")
+		}
+		journal = &uploadJournal{UploadID: uploadID}
+		if err := saveJournal(jPath, journal); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s3.uploadTimeout())
+
+	w := &s3Writer{
+		s3:          s3,
+		core:        core,
+		key:         key,
+		journalPath: jPath,
+		journal:     journal,
+		ctx:         ctx,
+		cancelCtx:   cancel,
+		// Size() assumes every already-completed part is a full
+		// partSize: parts are only ever flushed once they reach
+		// partSize (the last, possibly-shorter part is only written
+		// by Commit, which also finalizes the upload), so this
+		// always matches what was actually durably uploaded.
+		size: int64(len(journal.Parts)) * s3.partSize(),
+	}
+	return w, nil
+}
+
+// s3Writer implements FileWriter for S3Backend.
+type s3Writer struct {
+	s3          *S3Backend
+	core        *minio.Core
+	key         string
+	journalPath string
+	journal     *uploadJournal
+	ctx         context.Context
+	cancelCtx   context.CancelFunc
+
+	buf  []byte
+	size int64
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	partSize := w.s3.partSize()
+
+	for int64(len(w.buf)) >= partSize {
+		if err := w.flushPart(w.buf[:partSize]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[partSize:]
+	}
+
+	return len(p), nil
+}
+
+func (w *s3Writer) flushPart(data []byte) error {
+	partNumber := len(w.journal.Parts) + 1
+
+	part, err := uploadPartWithRetry(w.ctx, w.core, w.s3.config.Bucket, w.key, w.journal.UploadID, partNumber, data, w.s3.partRetryElapsed())
+	if err != nil {
+		return errors.Wrapf(err, "Error while uploading part %d", partNumber)
+	}
+
+	w.journal.Parts = append(w.journal.Parts, minio.CompletePart{PartNumber: partNumber, ETag: part.ETag})
+	w.size += int64(len(data))
+	return saveJournal(w.journalPath, w.journal)
+}
+
+// Size reports how many bytes have been durably uploaded as completed
+// parts. Bytes buffered in memory since the last full part don't count,
+// since they aren't resumable: a crash loses them and they must be
+// rewritten.
+func (w *s3Writer) Size() int64 {
+	return w.size
+}
+
+func (w *s3Writer) Close() error {
+	w.cancelCtx()
+	return nil
+}
+
+func (w *s3Writer) Cancel(ctx context.Context) error {
+	defer w.cancelCtx()
+	if err := w.core.AbortMultipartUpload(w.s3.config.Bucket, w.key, w.journal.UploadID); err != nil {
+		return errors.Wrap(err, "Error while aborting multipart upload")
+	}
+	return removeJournal(w.journalPath)
+}
+
+func (w *s3Writer) Commit(ctx context.Context) error {
+	defer w.cancelCtx()
+
+	if len(w.buf) > 0 {
+		if err := w.flushPart(w.buf); err != nil {
+			return err
+		}
+		w.buf = nil
+	}
+
+	if _, err := w.core.CompleteMultipartUpload(w.s3.config.Bucket, w.key, w.journal.UploadID, w.journal.Parts); err != nil {
+		return errors.Wrap(err, "Error while completing multipart upload")
+	}
+
+	return removeJournal(w.journalPath)
+}
+
+// uploadPartWithRetry uploads a single part, retrying on transient errors
+// with exponential backoff up to maxElapsed.
+func uploadPartWithRetry(ctx context.Context, core *minio.Core, bucket, object, uploadID string, partNumber int, data []byte, maxElapsed time.Duration) (minio.ObjectPart, error) {
+	var part minio.ObjectPart
+
+	operation := func() error {
+		p, err := core.PutObjectPart(bucket, object, uploadID, partNumber, bytes.NewReader(data), int64(len(data)), "", "", nil)
+		if err != nil {
+			if !isRetryableUploadError(err) {
+				return backoff.Permanent(err)
+			}
+			return err
+		}
+		part = p
+		return nil
+	}
+
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = maxElapsed
+
+	if err := backoff.Retry(operation, backoff.WithContext(b, ctx)); err != nil {
+		return minio.ObjectPart{}, err
+	}
+
+	return part, nil
+}
+
+// isRetryableUploadError reports whether err looks transient (a 5xx S3
+// response or a network error) and therefore worth retrying.
+func isRetryableUploadError(err error) bool {
+	if resp := minio.ToErrorResponse(err); resp.StatusCode >= 500 {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return false
+}
+
+// isNoSuchUploadError reports whether err is S3's NoSuchUpload: the upload
+// ID named in the request doesn't exist, typically because it was already
+// aborted (manually, or by a bucket lifecycle rule) since it was journaled.
+func isNoSuchUploadError(err error) bool {
+	return minio.ToErrorResponse(err).Code == "NoSuchUpload"
+}
@@ -1,24 +1,33 @@
 package blobstore
 
 import (
-	"crypto/sha256"
+	"crypto/md5"
 	"hash"
 	"io"
 	"io/ioutil"
 	"os"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/klauspost/pgzip"
+	"github.com/ulikunitz/xz"
 
 	"github.com/miolini/datacounter"
 	"github.com/pkg/errors"
 	pb "gopkg.in/cheggaaa/pb.v1"
 )
 
-// LocalBlob is a gzip compressed object, which may either be a single file
-// or a directory in a tar file
+// defaultHashAlgos are the content-addressing digests every LocalBlob
+// computes over its uncompressed data. HashMD5 is computed separately, over
+// the compressed bytes actually written to disk - see blob.md5.
+var defaultHashAlgos = []string{HashSHA256, HashSHA512, HashBLAKE3}
+
+// LocalBlob is a compressed object, which may either be a single file or a
+// directory in a tar file. It compresses using Format (FormatTarGz unless
+// created via NewLocalBlobFormat).
 type LocalBlob struct {
 	IsDir     bool
 	Reference string
+	Format    Format
 	// Size()
 	// UncompressedSize()
 	// Hash()
@@ -27,8 +36,9 @@ type LocalBlob struct {
 
 	pw *pb.ProgressBar
 
-	gw  io.WriteCloser             // gzip writer for compression
-	hw  hash.Hash                  // hashwriter for checksum
+	gw  io.WriteCloser             // compression writer (gzip/zstd/xz depending on Format)
+	mh  *MultiHash                 // fans out to every digest in defaultHashAlgos
+	md5 hash.Hash                  // MD5 of the compressed bytes, computed after gw
 	ccw *datacounter.WriterCounter // countWriter for counting written compressed bytes
 	ucw *datacounter.WriterCounter // countWriter for counting written uncompressed bytes
 	mw  io.Writer                  // multiWriter for combining hash and gzip
@@ -38,11 +48,21 @@ type LocalBlob struct {
 	// must not be used for any logic.
 }
 
-// NewLocalBlob creates a new blob with a temporary file, which MUST be
-// deleted after all related actions are complete.
+// NewLocalBlob creates a new gzip-compressed blob with a temporary file,
+// which MUST be deleted after all related actions are complete.
 func NewLocalBlob() (*LocalBlob, error) {
+	return NewLocalBlobFormat(FormatTarGz)
+}
+
+// NewLocalBlobFormat is like NewLocalBlob, but compresses with the given
+// Format instead of always using gzip. format must be one of FormatTar,
+// FormatTarGz, FormatTarZstd or FormatTarXz; the container-style formats
+// (FormatZip, FormatRar) don't fit the single streaming writer a blob
+// wraps and aren't accepted here.
+func NewLocalBlobFormat(format Format) (*LocalBlob, error) {
 	blob := &LocalBlob{
-		IsDir: false,
+		IsDir:  false,
+		Format: format,
 	}
 
 	var err error
@@ -62,14 +82,51 @@ func NewLocalBlob() (*LocalBlob, error) {
 	blob.pw.Start()
 
 	blob.ccw = datacounter.NewWriterCounter(blob.File)
-	blob.gw, _ = pgzip.NewWriterLevel(blob.ccw, pgzip.BestCompression)
+
+	// blob.md5 sits after the compressor, not in blob.mh alongside the
+	// other digests: it hashes the compressed bytes actually stored, since
+	// that's what an S3 ETag is computed over (see HashMD5).
+	blob.md5 = md5.New()
+	blob.gw, err = newCompressor(format, io.MultiWriter(blob.ccw, blob.md5))
+	if err != nil {
+		return nil, err
+	}
+
 	blob.ucw = datacounter.NewWriterCounter(blob.gw)
-	blob.hw = sha256.New()
-	blob.mw = io.MultiWriter(blob.ucw, blob.hw, blob.pw)
+	blob.mh, err = NewMultiHash(defaultHashAlgos...)
+	if err != nil {
+		return nil, err
+	}
+	blob.mw = io.MultiWriter(blob.ucw, blob.mh, blob.pw)
 
 	return blob, nil
 }
 
+// newCompressor returns the streaming compression writer for format, backed
+// by w.
+func newCompressor(format Format, w io.Writer) (io.WriteCloser, error) {
+	switch format {
+	case FormatTar:
+		return nopWriteCloser{w}, nil
+	case FormatTarGz:
+		return pgzip.NewWriterLevel(w, pgzip.BestCompression)
+	case FormatTarZstd:
+		return zstd.NewWriter(w)
+	case FormatTarXz:
+		return xz.NewWriter(w)
+	default:
+		return nil, errors.Errorf("blobstore: %q is not a supported blob compression format", format)
+	}
+}
+
+// nopWriteCloser adapts an io.Writer with no Close of its own (the
+// uncompressed FormatTar case) to io.WriteCloser.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
 // Close finishes the writing process to the blob
 func (blob *LocalBlob) Close() error {
 	blob.pw.Finish()
@@ -88,9 +145,19 @@ func (blob *LocalBlob) UncompressedSize() int64 {
 	return int64(blob.ucw.Count())
 }
 
-// Hash returns the checksum of the uncompressed data
+// Hash returns the SHA-256 checksum of the uncompressed data; this is the
+// digest blob keys are named after. Use Sums for the full set of digests.
 func (blob *LocalBlob) Hash() []byte {
-	return blob.hw.Sum(nil)
+	return blob.mh.Sum()[HashSHA256]
+}
+
+// Sums returns every configured digest, keyed by its Hash* algorithm name.
+// All but HashMD5 are over the uncompressed data; HashMD5 is over the
+// compressed bytes as stored (see HashMD5's doc comment).
+func (blob *LocalBlob) Sums() map[string][]byte {
+	sums := blob.mh.Sum()
+	sums[HashMD5] = blob.md5.Sum(nil)
+	return sums
 }
 
 // Write implements the standard Write interface
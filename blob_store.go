@@ -0,0 +1,382 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/pgzip"
+	"github.com/pkg/errors"
+	pb "gopkg.in/cheggaaa/pb.v1"
+)
+
+// BlobStore wraps a Backend with the blob-level logic - dedup, resumable
+// upload, chunked upload/download - so callers can swap storage (S3,
+// local filesystem, SFTP, in-memory for tests) without touching that
+// logic.
+type BlobStore struct {
+	backend Backend
+
+	// ChunkCacheDir is where chunks fetched by GetChunked are cached
+	// locally, keyed by chunk hash. Defaults to a subdirectory of
+	// os.TempDir() if empty.
+	ChunkCacheDir string
+}
+
+// NewBlobStore returns a BlobStore backed by backend.
+func NewBlobStore(backend Backend) *BlobStore {
+	return &BlobStore{backend: backend}
+}
+
+// blobExtension maps a blob's Format to the file extension its remote
+// object is stored under.
+var blobExtension = map[Format]string{
+	FormatTar:     "tar",
+	FormatTarGz:   "gz",
+	FormatTarZstd: "zst",
+	FormatTarXz:   "xz",
+}
+
+// blobKey returns the key a blob is stored/looked up under, named after
+// its hash and its compression Format.
+func blobKey(blob *LocalBlob) string {
+	return fmt.Sprintf("blob/%x.%s", blob.Hash(), blobExtension[blob.Format])
+}
+
+// manifestKey returns the key a ChunkManifest is stored under, named after
+// the hash of the whole uncompressed stream it describes.
+func manifestKey(hash []byte) string {
+	return fmt.Sprintf("blob/%x.manifest", hash)
+}
+
+// chunkKey returns the key an individual compressed chunk is stored under,
+// named after its own content hash.
+func chunkKey(hexHash string) string {
+	return fmt.Sprintf("chunk/%s.gz", hexHash)
+}
+
+// CheckDuplicate reports whether a blob with the same hash is already
+// stored. With no algos it only compares size, which is cheap but can't
+// tell apart two same-sized blobs with different content. Passing one or
+// more Hash* algos additionally fetches the stored digest metadata and
+// compares each against blob's own Sums, for callers that want stronger
+// assurance than size alone before skipping an upload.
+func (bs *BlobStore) CheckDuplicate(ctx context.Context, blob *LocalBlob, algos ...string) bool {
+	info, err := bs.backend.Stat(ctx, blobKey(blob))
+	if err != nil || info.Size != blob.Size() {
+		return false
+	}
+	if len(algos) == 0 {
+		return true
+	}
+
+	meta, err := bs.getMetadata(ctx, blob)
+	if err != nil {
+		return false
+	}
+
+	sums := blob.Sums()
+	for _, algo := range algos {
+		want, ok := sums[algo]
+		if !ok {
+			return false
+		}
+		if meta.Sums[algo] != hex.EncodeToString(want) {
+			return false
+		}
+	}
+	return true
+}
+
+// blobMetadata is the small JSON sidecar UploadBlob stores alongside a
+// blob, for the fields the Backend/FileWriter interfaces have nowhere
+// natural to carry (FileWriter.Write has no metadata parameter, unlike the
+// old direct minio-go upload this replaced).
+type blobMetadata struct {
+	UncompressedSize int64  `json:"uncompressed_size"`
+	Reference        string `json:"reference"`
+	IsDir            bool   `json:"is_dir"`
+
+	// Sums holds every digest from blob.Sums(), hex-encoded and keyed by
+	// its Hash* algorithm name, so CheckDuplicate can verify a stored
+	// blob by any of them without re-reading it.
+	Sums map[string]string `json:"sums"`
+}
+
+func (bs *BlobStore) putMetadata(ctx context.Context, blob *LocalBlob) error {
+	sums := make(map[string]string, len(blob.Sums()))
+	for algo, sum := range blob.Sums() {
+		sums[algo] = hex.EncodeToString(sum)
+	}
+
+	data, err := json.Marshal(blobMetadata{
+		UncompressedSize: blob.UncompressedSize(),
+		Reference:        blob.Reference,
+		IsDir:            blob.IsDir,
+		Sums:             sums,
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error while encoding blob metadata")
+	}
+
+	return bs.backend.Put(ctx, blobKey(blob)+".meta", bytes.NewReader(data), int64(len(data)), nil)
+}
+
+// getMetadata fetches and decodes the JSON sidecar putMetadata stored for
+// blob.
+func (bs *BlobStore) getMetadata(ctx context.Context, blob *LocalBlob) (*blobMetadata, error) {
+	r, err := bs.backend.Get(ctx, blobKey(blob)+".meta", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var meta blobMetadata
+	if err := json.NewDecoder(r).Decode(&meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// UploadBlob takes a blob, and uploads it to the store (referenced by its
+// hash) via the backend's resumable Writer, so a re-invocation of
+// UploadBlob on the same LocalBlob after a crash resumes instead of
+// restarting. blob must already be Close()d: UploadBlob reads it back from
+// disk by name rather than through blob.File, which Close leaves closed.
+func (bs *BlobStore) UploadBlob(ctx context.Context, blob *LocalBlob) error {
+	key := blobKey(blob)
+
+	f, err := os.Open(blob.File.Name())
+	if err != nil {
+		return errors.Wrap(err, "Error while reopening blob")
+	}
+	defer f.Close()
+
+	w, err := bs.backend.Writer(ctx, key)
+	if err != nil {
+		return errors.Wrap(err, "Error while opening upload")
+	}
+
+	if _, err := f.Seek(w.Size(), io.SeekStart); err != nil {
+		w.Cancel(ctx)
+		return errors.Wrap(err, "Error while resuming upload")
+	}
+
+	bar := pb.New64(blob.Size())
+	bar.ShowSpeed = true
+	bar.ShowElapsedTime = true
+	bar.ShowTimeLeft = true
+	bar.Units = pb.U_BYTES
+	bar.ShowFinalTime = true
+	bar.Set64(w.Size())
+	bar.Start()
+	defer bar.Finish()
+
+	if _, err := io.Copy(w, bar.NewProxyReader(f)); err != nil {
+		w.Close()
+		return errors.Wrap(err, "Error while uploading blob")
+	}
+
+	if err := w.Commit(ctx); err != nil {
+		return errors.Wrap(err, "Error while completing upload")
+	}
+
+	return bs.putMetadata(ctx, blob)
+}
+
+// UploadDir will take an entire local dir, and upload it to the store,
+// returning its reference/checksum
+func (bs *BlobStore) UploadDir(ctx context.Context, src string) ([]byte, error) {
+	blob, err := NewLocalBlob()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to prepare dir blob")
+	}
+	blob.IsDir = true
+	defer os.Remove(blob.File.Name())
+	defer blob.Close()
+
+	if err := TarDir(src, blob); err != nil {
+		return nil, errors.Wrap(err, "Failed to tar dir")
+	}
+	if err := blob.Close(); err != nil {
+		return nil, errors.Wrap(err, "Failed to flush blob dir")
+	}
+
+	if bs.CheckDuplicate(ctx, blob) {
+		// already exists, exit early
+		return blob.Hash(), nil
+	}
+
+	if err := bs.UploadBlob(ctx, blob); err != nil {
+		return blob.Hash(), errors.Wrap(err, "Failed to upload dir")
+	}
+
+	return blob.Hash(), nil
+}
+
+// UploadDirChunked tars src and uploads it as a chunked blob instead of
+// one monolithic compressed object: the tar stream is split into
+// content-defined chunks that are stored and deduplicated independently of
+// one another, so directory uploads that mostly overlap with a previous
+// upload only transfer their changed chunks. It returns the hash of the
+// whole (uncompressed) tar stream.
+func (bs *BlobStore) UploadDirChunked(ctx context.Context, src string) ([]byte, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(TarDir(src, pw))
+	}()
+
+	blob, err := NewChunkedBlob(pr)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to chunk dir")
+	}
+	defer blob.Close()
+
+	if err := bs.UploadChunked(ctx, blob); err != nil {
+		return blob.Hash(), errors.Wrap(err, "Failed to upload chunked dir")
+	}
+
+	return blob.Hash(), nil
+}
+
+// UploadChunked uploads a ChunkedBlob's manifest and any of its chunks
+// that aren't already stored (from this or an earlier overlapping
+// upload).
+func (bs *BlobStore) UploadChunked(ctx context.Context, blob *ChunkedBlob) error {
+	for _, entry := range blob.Manifest.Entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		key := chunkKey(entry.Hash)
+		if _, err := bs.backend.Stat(ctx, key); err == nil {
+			// already stored, possibly by an earlier overlapping upload
+			continue
+		}
+
+		if err := bs.putChunkFile(ctx, key, blob.chunkPath(entry.Hash)); err != nil {
+			return errors.Wrapf(err, "Error while uploading chunk %s", entry.Hash)
+		}
+	}
+
+	data, err := json.Marshal(blob.Manifest)
+	if err != nil {
+		return errors.Wrap(err, "Error while encoding manifest")
+	}
+
+	return bs.backend.Put(ctx, manifestKey(blob.Hash()), bytes.NewReader(data), int64(len(data)), nil)
+}
+
+func (bs *BlobStore) putChunkFile(ctx context.Context, key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	return bs.backend.Put(ctx, key, f, fi.Size(), nil)
+}
+
+// GetChunked reassembles the stream named by hash, writing it to w.
+// Chunks already present in the local chunk cache are reused as-is; only
+// chunks missing from the cache are fetched from the backend, so
+// re-downloading a blob that shares chunks with one already cached (e.g.
+// a slightly changed directory) only transfers what actually changed.
+func (bs *BlobStore) GetChunked(ctx context.Context, hash []byte, w io.Writer) error {
+	manifestObj, err := bs.backend.Get(ctx, manifestKey(hash), 0, 0)
+	if err != nil {
+		return errors.Wrap(err, "Error while fetching manifest")
+	}
+	defer manifestObj.Close()
+
+	var manifest ChunkManifest
+	if err := json.NewDecoder(manifestObj).Decode(&manifest); err != nil {
+		return errors.Wrap(err, "Error while decoding manifest")
+	}
+
+	cacheDir := bs.chunkCacheDir()
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return errors.Wrap(err, "Error while preparing chunk cache")
+	}
+
+	for _, entry := range manifest.Entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		cachePath := filepath.Join(cacheDir, entry.Hash+".gz")
+
+		if _, err := os.Stat(cachePath); err != nil {
+			if err := bs.fetchChunk(ctx, entry.Hash, cachePath); err != nil {
+				return err
+			}
+		}
+
+		if err := copyChunk(w, cachePath); err != nil {
+			return errors.Wrapf(err, "Error while copying chunk %s", entry.Hash)
+		}
+	}
+
+	return nil
+}
+
+// fetchChunk downloads the chunk with the given hash into the chunk cache
+// at cachePath, via a temp file so a failed download never leaves a
+// corrupt entry behind.
+func (bs *BlobStore) fetchChunk(ctx context.Context, hexHash, cachePath string) error {
+	r, err := bs.backend.Get(ctx, chunkKey(hexHash), 0, 0)
+	if err != nil {
+		return errors.Wrapf(err, "Error while fetching chunk %s", hexHash)
+	}
+	defer r.Close()
+
+	tmp := cachePath + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return errors.Wrapf(err, "Error while caching chunk %s", hexHash)
+	}
+	f.Close()
+
+	return os.Rename(tmp, cachePath)
+}
+
+func (bs *BlobStore) chunkCacheDir() string {
+	if bs.ChunkCacheDir != "" {
+		return bs.ChunkCacheDir
+	}
+	return filepath.Join(os.TempDir(), "blobstore-chunk-cache")
+}
+
+// copyChunk decompresses the gzip chunk file at path and copies it to w.
+func copyChunk(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gr, err := pgzip.NewReader(f)
+	if err != nil {
+		return errors.Wrap(err, "could not open chunk")
+	}
+	defer gr.Close()
+
+	_, err = io.Copy(w, gr)
+	return err
+}
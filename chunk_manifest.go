@@ -0,0 +1,129 @@
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/pgzip"
+	"github.com/pkg/errors"
+)
+
+// ChunkEntry describes one content-defined chunk of a ChunkManifest: its
+// content hash, its offset in the reassembled uncompressed stream, and its
+// uncompressed/compressed sizes.
+type ChunkEntry struct {
+	Hash            string `json:"hash"`
+	Offset          int64  `json:"offset"`
+	UncompressedLen int64  `json:"uncompressed_len"`
+	CompressedLen   int64  `json:"compressed_len"`
+}
+
+// ChunkManifest lists, in stream order, the chunks an uncompressed byte
+// stream was split into. It is stored remotely at blob/<hash>.manifest in
+// place of a monolithic compressed object.
+type ChunkManifest struct {
+	Entries []ChunkEntry `json:"entries"`
+}
+
+// ChunkedBlob is the chunked counterpart to LocalBlob. Instead of one
+// monolithic compressed file it holds a ChunkManifest plus the
+// individually gzip-compressed chunks, each written to its own temp file
+// under a directory that MUST be removed via Close once uploading is done.
+type ChunkedBlob struct {
+	Manifest ChunkManifest
+
+	hash []byte
+	dir  string
+}
+
+// NewChunkedBlob reads r to EOF, splitting it into content-defined chunks
+// with a Chunker. Each chunk is hashed (SHA-256) and gzip-compressed to its
+// own temp file named after that hash.
+func NewChunkedBlob(r io.Reader) (*ChunkedBlob, error) {
+	dir, err := ioutil.TempDir("", "blobstore-chunks")
+	if err != nil {
+		return nil, errors.Wrap(err, "ChunkedBlob: could not create temp dir")
+	}
+
+	blob := &ChunkedBlob{dir: dir}
+
+	hw := sha256.New()
+	chunker := NewChunker(io.TeeReader(r, hw))
+
+	var offset int64
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, errors.Wrap(err, "ChunkedBlob: could not read chunk")
+		}
+
+		sum := sha256.Sum256(chunk)
+		hexHash := hex.EncodeToString(sum[:])
+
+		compressedLen, err := writeGzipFile(blob.chunkPath(hexHash), chunk)
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, errors.Wrap(err, "ChunkedBlob: could not write chunk")
+		}
+
+		blob.Manifest.Entries = append(blob.Manifest.Entries, ChunkEntry{
+			Hash:            hexHash,
+			Offset:          offset,
+			UncompressedLen: int64(len(chunk)),
+			CompressedLen:   compressedLen,
+		})
+		offset += int64(len(chunk))
+	}
+
+	blob.hash = hw.Sum(nil)
+	return blob, nil
+}
+
+// Hash returns the checksum of the whole uncompressed stream, used as the
+// manifest's own content address (blob/<hash>.manifest).
+func (blob *ChunkedBlob) Hash() []byte {
+	return blob.hash
+}
+
+// chunkPath returns the local temp-file path of the gzip-compressed chunk
+// with the given hex hash.
+func (blob *ChunkedBlob) chunkPath(hexHash string) string {
+	return filepath.Join(blob.dir, hexHash+".gz")
+}
+
+// Close removes the temp directory holding the blob's compressed chunks.
+func (blob *ChunkedBlob) Close() error {
+	return os.RemoveAll(blob.dir)
+}
+
+// writeGzipFile gzip-compresses data into a new file at path, returning the
+// compressed size.
+func writeGzipFile(path string, data []byte) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	gw := pgzip.NewWriter(f)
+	if _, err := gw.Write(data); err != nil {
+		return 0, err
+	}
+	if err := gw.Close(); err != nil {
+		return 0, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,121 @@
+package blobstore
+
+import (
+	"io"
+	"math/rand"
+)
+
+// Content-defined chunk size bounds used by the FastCDC chunker below.
+const (
+	MinChunkSize    = 2 * 1024
+	TargetChunkSize = 8 * 1024
+	MaxChunkSize    = 64 * 1024
+)
+
+// gearSeed fixes the PRNG seed the Gear table is generated from, so that
+// chunk boundaries are reproducible across processes and machines -
+// required for chunks of identical content to actually dedup against each
+// other in the store.
+const gearSeed = 0x426c6f62
+
+var gearTable = newGearTable()
+
+func newGearTable() [256]uint64 {
+	var t [256]uint64
+	rnd := rand.New(rand.NewSource(gearSeed))
+	for i := range t {
+		t[i] = rnd.Uint64()
+	}
+	return t
+}
+
+// Normalized chunking masks (see Xia et al., "FastCDC: a Fast and Efficient
+// Content-Defined Chunking Approach for Data Deduplication", USENIX ATC
+// '16). maskSmall has more set bits and is used below TargetChunkSize, so a
+// cut there is unlikely - this pulls chunk boundaries towards the target
+// size instead of scattering them near MinChunkSize. maskLarge has fewer
+// set bits and is used above TargetChunkSize, making a cut far more likely
+// and bounding how often a chunk grows all the way to MaxChunkSize.
+const (
+	maskSmallBits = 15
+	maskLargeBits = 11
+)
+
+var (
+	maskSmall = uint64(1)<<maskSmallBits - 1
+	maskLarge = uint64(1)<<maskLargeBits - 1
+)
+
+// Chunker splits a byte stream into content-defined chunks using a 64-bit
+// Gear hash rolling checksum, so that two streams sharing a run of bytes
+// tend to split into some identical chunks regardless of where that run
+// starts in either stream.
+type Chunker struct {
+	r       io.Reader
+	buf     []byte
+	pending []byte
+	eof     bool
+}
+
+// NewChunker returns a Chunker reading content-defined chunks from r.
+func NewChunker(r io.Reader) *Chunker {
+	return &Chunker{r: r, buf: make([]byte, 32*1024)}
+}
+
+// Next returns the next chunk. It returns io.EOF once r is exhausted and
+// every chunk has been returned.
+func (c *Chunker) Next() ([]byte, error) {
+	for !c.eof && len(c.pending) < MaxChunkSize {
+		n, err := c.r.Read(c.buf)
+		if n > 0 {
+			c.pending = append(c.pending, c.buf[:n]...)
+		}
+		if err == io.EOF {
+			c.eof = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(c.pending) == 0 {
+		return nil, io.EOF
+	}
+
+	cut := cutPoint(c.pending, c.eof)
+	chunk := c.pending[:cut]
+	c.pending = c.pending[cut:]
+	return chunk, nil
+}
+
+// cutPoint reports where to split data using the Gear-hash rolling
+// checksum. If final is true, data is the remainder of the stream and may
+// be shorter than MinChunkSize, in which case it is returned whole.
+func cutPoint(data []byte, final bool) int {
+	max := MaxChunkSize
+	if len(data) < max {
+		if final {
+			return len(data)
+		}
+		max = len(data)
+	}
+	if max <= MinChunkSize {
+		return max
+	}
+
+	var fp uint64
+	for i := MinChunkSize; i < max; i++ {
+		fp = (fp << 1) + gearTable[data[i]]
+
+		mask := maskLarge
+		if i < TargetChunkSize {
+			mask = maskSmall
+		}
+		if fp&mask == 0 {
+			return i + 1
+		}
+	}
+
+	return max
+}
@@ -0,0 +1,115 @@
+package blobstore
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// chunkAll drains a Chunker into a slice of chunks.
+func chunkAll(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+
+	chunker := NewChunker(bytes.NewReader(data))
+	var chunks [][]byte
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		chunks = append(chunks, append([]byte(nil), chunk...))
+	}
+	return chunks
+}
+
+// TestChunkerRoundTrip checks that concatenating the chunks a Chunker
+// produces reassembles the original stream exactly.
+func TestChunkerRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 10*MaxChunkSize)
+	rnd.Read(data)
+
+	chunks := chunkAll(t, data)
+
+	var got []byte
+	for _, c := range chunks {
+		got = append(got, c...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("reassembled stream does not match input (got %d bytes, want %d)", len(got), len(data))
+	}
+}
+
+// TestChunkerDeterministic checks that chunking the same content twice -
+// in separate Chunker instances, as separate process runs would - produces
+// identical cut points. Cross-run determinism is what lets identical
+// chunks dedup against each other in the store.
+func TestChunkerDeterministic(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	data := make([]byte, 10*MaxChunkSize)
+	rnd.Read(data)
+
+	first := chunkAll(t, data)
+	second := chunkAll(t, data)
+
+	if len(first) != len(second) {
+		t.Fatalf("chunk count differs across runs: %d vs %d", len(first), len(second))
+	}
+	for i := range first {
+		if !bytes.Equal(first[i], second[i]) {
+			t.Fatalf("chunk %d differs across runs", i)
+		}
+	}
+}
+
+// TestChunkerSharedRunDedups checks the property the whole scheme exists
+// for: two streams that share a long run of bytes starting at different
+// offsets still produce at least one identical chunk for that run.
+func TestChunkerSharedRunDedups(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	shared := make([]byte, 4*MaxChunkSize)
+	rnd.Read(shared)
+
+	prefixA := make([]byte, 17)
+	rnd.Read(prefixA)
+	prefixB := make([]byte, 401)
+	rnd.Read(prefixB)
+
+	a := chunkAll(t, append(append([]byte(nil), prefixA...), shared...))
+	b := chunkAll(t, append(append([]byte(nil), prefixB...), shared...))
+
+	seen := make(map[string]bool, len(a))
+	for _, c := range a {
+		seen[string(c)] = true
+	}
+	for _, c := range b {
+		if seen[string(c)] {
+			return
+		}
+	}
+	t.Fatal("no identical chunk found between two streams sharing a long run")
+}
+
+// TestChunkBoundaries checks every non-final chunk stays within
+// [MinChunkSize, MaxChunkSize], the invariant cutPoint's search bounds
+// enforce.
+func TestChunkBoundaries(t *testing.T) {
+	rnd := rand.New(rand.NewSource(4))
+	data := make([]byte, 20*MaxChunkSize)
+	rnd.Read(data)
+
+	chunks := chunkAll(t, data)
+	for i, c := range chunks {
+		final := i == len(chunks)-1
+		if !final && len(c) < MinChunkSize {
+			t.Fatalf("non-final chunk %d is %d bytes, below MinChunkSize %d", i, len(c), MinChunkSize)
+		}
+		if len(c) > MaxChunkSize {
+			t.Fatalf("chunk %d is %d bytes, above MaxChunkSize %d", i, len(c), MaxChunkSize)
+		}
+	}
+}
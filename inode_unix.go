@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package blobstore
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode returns fi's inode number, used by TarDir to detect hardlinks.
+// ok is false if fi carries no syscall.Stat_t (shouldn't happen on unix).
+func fileInode(fi os.FileInfo) (ino uint64, ok bool) {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return stat.Ino, true
+}
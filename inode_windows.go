@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package blobstore
+
+import "os"
+
+// fileInode always reports ok=false on Windows: os.FileInfo carries no
+// inode there, so TarDir never detects hardlinks on this platform.
+func fileInode(fi os.FileInfo) (ino uint64, ok bool) {
+	return 0, false
+}
@@ -0,0 +1,83 @@
+package blobstore
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/zeebo/blake3"
+)
+
+// Hash algorithm names accepted by NewMultiHash.
+const (
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+	HashBLAKE3 = "blake3"
+	// HashMD5 is kept around for S3 ETag compatibility: a single-part S3
+	// object's ETag is the MD5 of its body. LocalBlob computes it over the
+	// compressed bytes it stores (not alongside the other digests below,
+	// which cover the uncompressed data), so it only matches the ETag of
+	// an object actually PUT in a single part; a multipart upload's ETag
+	// is a composite of per-part MD5s and this digest won't equal it.
+	HashMD5 = "md5"
+)
+
+func newHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashSHA512:
+		return sha512.New(), nil
+	case HashBLAKE3:
+		return blake3.New(), nil
+	case HashMD5:
+		return md5.New(), nil
+	default:
+		return nil, errors.Errorf("blobstore: %q is not a supported hash algorithm", algo)
+	}
+}
+
+// MultiHash fans writes out to a configurable set of named hash.Hash
+// algorithms via io.MultiWriter, so a single pass over a stream can produce
+// several digests instead of one, without re-reading it per algorithm.
+type MultiHash struct {
+	hashes map[string]hash.Hash
+	w      io.Writer
+}
+
+// NewMultiHash returns a MultiHash writing to the given algorithms (see the
+// Hash* constants). It implements io.Writer: every Write updates all of
+// algos' digests at once.
+func NewMultiHash(algos ...string) (*MultiHash, error) {
+	hashes := make(map[string]hash.Hash, len(algos))
+	writers := make([]io.Writer, 0, len(algos))
+
+	for _, algo := range algos {
+		h, err := newHash(algo)
+		if err != nil {
+			return nil, err
+		}
+		hashes[algo] = h
+		writers = append(writers, h)
+	}
+
+	return &MultiHash{hashes: hashes, w: io.MultiWriter(writers...)}, nil
+}
+
+// Write implements io.Writer, updating every configured algorithm's digest.
+func (mh *MultiHash) Write(p []byte) (int, error) {
+	return mh.w.Write(p)
+}
+
+// Sum returns the current digest of each configured algorithm, keyed by its
+// Hash* name.
+func (mh *MultiHash) Sum() map[string][]byte {
+	sums := make(map[string][]byte, len(mh.hashes))
+	for algo, h := range mh.hashes {
+		sums[algo] = h.Sum(nil)
+	}
+	return sums
+}
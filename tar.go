@@ -5,10 +5,13 @@ import (
 	"archive/zip"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/klauspost/pgzip"
@@ -16,65 +19,238 @@ import (
 	"github.com/pkg/errors"
 )
 
+// TarDirOptions configures TarDirWithOptions.
+type TarDirOptions struct {
+	// Concurrency is how many workers read file bodies in parallel.
+	// Defaults to runtime.NumCPU() if <= 0; set to 1 to read serially.
+	Concurrency int
+
+	// Xattrs captures each entry's extended attributes into its header's
+	// PAXRecords, under the "SCHILY.xattr." prefix (the same convention
+	// GNU tar/libarchive use), so Untargz can restore them. Only has an
+	// effect on Linux; ignored elsewhere.
+	Xattrs bool
+}
+
+// TarDir is TarDirWithOptions with the default TarDirOptions (runtime.NumCPU()
+// workers).
 func TarDir(src string, writer io.Writer) error {
+	return TarDirWithOptions(src, writer, TarDirOptions{})
+}
+
+// errTarDirStopped is the filepath.Walk error used to unwind the walk
+// goroutine once TarDirWithOptions has already failed for another reason.
+var errTarDirStopped = errors.New("blobstore: tar aborted")
+
+// tarWorkerBodyCap bounds how much of a regular file a worker goroutine may
+// read ahead of the writer. Files at or under this size are read whole into
+// a buffer, bounding worst-case memory to roughly 2x opts.Concurrency times
+// this cap; files over it are streamed directly by the writer goroutine
+// instead, the same as the baseline's serial io.CopyBuffer path, so a
+// directory with a few large files can't balloon memory into the GBs.
+const tarWorkerBodyCap = 4 * 1024 * 1024
+
+// tarFile carries one walked entry from the walker goroutine to the writer
+// goroutine in TarDirWithOptions. regular is true for TypeReg entries. body
+// is only set for regular files at or under tarWorkerBodyCap, and is filled
+// in by a worker goroutine reading concurrently with the walk; bigger
+// regular files are streamed directly by the writer instead (see big).
+type tarFile struct {
+	header  *tar.Header
+	path    string
+	regular bool
+	big     bool
+	body    chan tarBody // buffered 1; unused when big
+}
+
+type tarBody struct {
+	data []byte
+	err  error
+}
+
+// TarDirWithOptions walks src and writes it as a tar stream. A single
+// goroutine walks the tree and emits headers in path order; opts.Concurrency
+// workers read regular files at or under tarWorkerBodyCap into bounded
+// buffers concurrently, but the writer goroutine only ever drains them in
+// walk order, so output bytes are byte-identical and deterministic
+// regardless of concurrency - the worker pool only overlaps disk reads with
+// each other and with whatever compression is layered on writer downstream
+// (e.g. pgzip). Files over tarWorkerBodyCap are streamed directly by the
+// writer goroutine instead, so memory use stays bounded regardless of how
+// large any single file is.
+func TarDirWithOptions(src string, writer io.Writer, opts TarDirOptions) error {
 	// ensure the src actually exists before trying to tar it
 	if _, err := os.Stat(src); err != nil {
 		return fmt.Errorf("Unable to tar files - %v", err.Error())
 	}
 
-	tw := tar.NewWriter(writer)
-	defer tw.Close()
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
 
-	// reusable buffer for io.CopyBuffer
-	copyBuffer := make([]byte, 32*1024)
+	files := make(chan *tarFile, concurrency)
+	toRead := make(chan *tarFile, concurrency)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	abort := func() { stopOnce.Do(func() { close(stop) }) }
+
+	var workers sync.WaitGroup
+	workers.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer workers.Done()
+			for tf := range toRead {
+				data, err := ioutil.ReadFile(tf.path)
+				tf.body <- tarBody{data: data, err: err}
+			}
+		}()
+	}
 
-	// walk path
-	return filepath.Walk(src, func(file string, fi os.FileInfo, err error) error {
+	walkDone := make(chan error, 1)
+	go func() {
+		defer close(toRead)
+		defer close(files)
 
-		// return on any error
-		if err != nil {
-			return err
-		}
+		// seenInodes maps an inode already written as a regular file to
+		// the tar name it was written under, so later walk entries for
+		// the same inode (hardlinks) are emitted as tar.TypeLink
+		// referencing it instead of duplicating the body. Only touched
+		// by this goroutine, so it needs no locking.
+		seenInodes := make(map[uint64]string)
 
-		// create a new dir/file header
-		header, err := tar.FileInfoHeader(fi, fi.Name())
-		if err != nil {
-			return err
+		walkDone <- filepath.Walk(src, func(file string, fi os.FileInfo, err error) error {
+			// return on any error
+			if err != nil {
+				return err
+			}
+
+			// a symlink's FileInfoHeader link target is read separately:
+			// fi.Name() is just the link's own basename
+			link := fi.Name()
+			if fi.Mode()&os.ModeSymlink != 0 {
+				target, err := os.Readlink(file)
+				if err != nil {
+					return err
+				}
+				link = target
+			}
+
+			// create a new dir/file header
+			header, err := tar.FileInfoHeader(fi, link)
+			if err != nil {
+				return err
+			}
+
+			// reset modification time, to make output deterministic
+			header.ModTime = time.Time{}
+
+			// update the name to correctly reflect the desired destination when untaring
+			header.Name = strings.TrimPrefix(strings.Replace(file, src, "", -1), string(filepath.Separator))
+
+			isRegular := fi.Mode().IsRegular()
+
+			// a second-and-later walk entry for the same inode is a
+			// hardlink: emit it as TypeLink referencing the first name
+			// it was seen under, instead of duplicating the body
+			if isRegular {
+				if ino, ok := fileInode(fi); ok {
+					if firstName, seen := seenInodes[ino]; seen {
+						header.Typeflag = tar.TypeLink
+						header.Linkname = firstName
+						header.Size = 0
+						isRegular = false
+					} else {
+						seenInodes[ino] = header.Name
+					}
+				}
+			}
+
+			if opts.Xattrs {
+				attrs, err := readXattrs(file)
+				if err != nil {
+					return err
+				}
+				for name, val := range attrs {
+					if header.PAXRecords == nil {
+						header.PAXRecords = make(map[string]string, len(attrs))
+					}
+					header.PAXRecords[xattrPrefix+name] = val
+				}
+			}
+
+			tf := &tarFile{header: header, path: file, regular: isRegular}
+			if isRegular {
+				if header.Size > tarWorkerBodyCap {
+					tf.big = true
+				} else {
+					tf.body = make(chan tarBody, 1)
+					select {
+					case toRead <- tf:
+					case <-stop:
+						return errTarDirStopped
+					}
+				}
+			}
+
+			select {
+			case files <- tf:
+				return nil
+			case <-stop:
+				return errTarDirStopped
+			}
+		})
+	}()
+	defer func() {
+		abort()
+		for range files {
 		}
+		workers.Wait()
+	}()
 
-		// reset modification time, to make output deterministic
-		header.ModTime = time.Time{}
+	tw := tar.NewWriter(writer)
+	defer tw.Close()
 
-		// update the name to correctly reflect the desired destination when untaring
-		header.Name = strings.TrimPrefix(strings.Replace(file, src, "", -1), string(filepath.Separator))
+	// reused across every big file, the same way untar reuses copyBuffer
+	copyBuffer := make([]byte, 32*1024)
 
-		// write the header
-		if err := tw.WriteHeader(header); err != nil {
+	for tf := range files {
+		if err := tw.WriteHeader(tf.header); err != nil {
 			return err
 		}
 
-		// return on non-regular files)
-		if !fi.Mode().IsRegular() {
-			return nil
+		// non-regular files have no body to write
+		if !tf.regular {
+			continue
 		}
 
-		// open files for taring
-		f, err := os.Open(file)
-		if err != nil {
-			return err
+		if tf.big {
+			f, err := os.Open(tf.path)
+			if err != nil {
+				return err
+			}
+			_, err = io.CopyBuffer(tw, f, copyBuffer)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			continue
 		}
 
-		// copy file data into tar writer
-		if _, err := io.CopyBuffer(tw, f, copyBuffer); err != nil {
+		body := <-tf.body
+		if body.err != nil {
+			return body.err
+		}
+		if _, err := tw.Write(body.data); err != nil {
 			return err
 		}
+	}
 
-		// manually close here after each file operation; defering would cause each file close
-		// to wait until all operations have completed.
-		f.Close()
+	if err := <-walkDone; err != nil && err != errTarDirStopped {
+		return err
+	}
 
-		return nil
-	})
+	return nil
 }
 
 // Untargz takes a destination path and a reader; a tar reader loops over the tarfile
@@ -87,7 +263,14 @@ func Untargz(dst string, r io.Reader) error {
 	}
 	defer gzr.Close()
 
-	tr := tar.NewReader(gzr)
+	return untar(dst, tar.NewReader(gzr))
+}
+
+// untar drains tr, recreating its entries under dst. It is the shared core
+// behind Untargz and the tar-flavoured Archivers (archive_tar.go,
+// archive_xz.go, archive_zstd.go); only the
+// decompression layered in front of tr differs between them.
+func untar(dst string, tr *tar.Reader) error {
 
 	// reusable buffer for io.CopyBuffer
 	copyBuffer := make([]byte, 32*1024)
@@ -111,7 +294,10 @@ func Untargz(dst string, r io.Reader) error {
 		}
 
 		// the target location where the dir/file should be created
-		target := filepath.Join(dst, header.Name)
+		target, err := sanitizeExtractPath(dst, header.Name)
+		if err != nil {
+			return err
+		}
 
 		// the following switch could also be done using fi.Mode(), not sure if there
 		// a benefit of using one vs. the other.
@@ -128,8 +314,16 @@ func Untargz(dst string, r io.Reader) error {
 				}
 			}
 
+			if err := restoreHeaderXattrs(target, header); err != nil {
+				return err
+			}
+
 		// if it's a file create it
 		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+
 			f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
 			if err != nil {
 				return err
@@ -144,17 +338,51 @@ func Untargz(dst string, r io.Reader) error {
 			// to wait until all operations have completed.
 			f.Close()
 
+			if err := restoreHeaderXattrs(target, header); err != nil {
+				return err
+			}
+
 		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
 			if err := os.Symlink(header.Linkname, target); err != nil {
 				return err
 			}
 
+		case tar.TypeLink:
+			linkTarget, err := sanitizeExtractPath(dst, header.Linkname)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Link(linkTarget, target); err != nil {
+				return err
+			}
+
 		default:
 			log.Print("Tar: ignoring unknown tar header")
 		}
 	}
 }
 
+// restoreHeaderXattrs restores every "SCHILY.xattr."-prefixed PAXRecord
+// TarDir captured (with TarDirOptions.Xattrs) back onto target.
+func restoreHeaderXattrs(target string, header *tar.Header) error {
+	for key, val := range header.PAXRecords {
+		if !strings.HasPrefix(key, xattrPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, xattrPrefix)
+		if err := restoreXattr(target, name, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func TarZip(reader io.ReaderAt, size int64, writer io.Writer) error {
 	zr, err := zip.NewReader(reader, size)
 	if err != nil {
@@ -0,0 +1,149 @@
+package blobstore
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestTree creates n small files (plus one subdirectory) under a fresh
+// temp directory and returns its path.
+func writeTestTree(t *testing.T, n int) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "blobstore-tardir")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+
+	for i := 0; i < n; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("file-%03d.txt", i))
+		if i%3 == 0 {
+			path = filepath.Join(sub, fmt.Sprintf("file-%03d.txt", i))
+		}
+		content := []byte(fmt.Sprintf("content of file %d\n", i))
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	return dir
+}
+
+// TestTarDirWithOptionsDeterministic checks that tarring the same tree with
+// different worker-pool sizes produces byte-identical output: the writer
+// goroutine always drains file bodies in walk order regardless of how many
+// workers race to read them.
+func TestTarDirWithOptionsDeterministic(t *testing.T) {
+	dir := writeTestTree(t, 30)
+
+	var serial bytes.Buffer
+	if err := TarDirWithOptions(dir, &serial, TarDirOptions{Concurrency: 1}); err != nil {
+		t.Fatalf("TarDirWithOptions (concurrency 1): %v", err)
+	}
+
+	var parallel bytes.Buffer
+	if err := TarDirWithOptions(dir, &parallel, TarDirOptions{Concurrency: 8}); err != nil {
+		t.Fatalf("TarDirWithOptions (concurrency 8): %v", err)
+	}
+
+	if !bytes.Equal(serial.Bytes(), parallel.Bytes()) {
+		t.Fatal("tar output differs between concurrency 1 and concurrency 8")
+	}
+}
+
+// failingWriter returns errWriteFailed after n successful bytes, so tests
+// can exercise TarDirWithOptions' abort path.
+type failingWriter struct {
+	remaining int
+}
+
+var errWriteFailed = fmt.Errorf("blobstore: simulated write failure")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.remaining <= 0 {
+		return 0, errWriteFailed
+	}
+	if len(p) > w.remaining {
+		p = p[:w.remaining]
+	}
+	w.remaining -= len(p)
+	return len(p), nil
+}
+
+// TestTarDirWithOptionsAbortsOnWriteError checks that a downstream write
+// failure unwinds the walk and worker goroutines and surfaces the error,
+// rather than hanging or silently succeeding.
+func TestTarDirWithOptionsAbortsOnWriteError(t *testing.T) {
+	dir := writeTestTree(t, 50)
+
+	err := TarDirWithOptions(dir, &failingWriter{remaining: 64}, TarDirOptions{Concurrency: 4})
+	if err == nil {
+		t.Fatal("expected an error from a failing writer, got nil")
+	}
+}
+
+// TestTarDirWithOptionsStreamsLargeFiles checks that a file over
+// tarWorkerBodyCap round-trips correctly - it's streamed directly by the
+// writer goroutine rather than prefetched whole into memory by a worker,
+// and that path must produce the same bytes as the small-file path.
+func TestTarDirWithOptionsStreamsLargeFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobstore-tardir-big")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	big := make([]byte, tarWorkerBodyCap+(1<<20))
+	rand.New(rand.NewSource(5)).Read(big)
+	wantSum := sha256.Sum256(big)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "big.bin"), big, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := TarDirWithOptions(dir, &buf, TarDirOptions{Concurrency: 4}); err != nil {
+		t.Fatalf("TarDirWithOptions: %v", err)
+	}
+
+	tr := tar.NewReader(&buf)
+	var found bool
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tr.Next: %v", err)
+		}
+		if hdr.Name != "big.bin" {
+			continue
+		}
+		found = true
+
+		h := sha256.New()
+		if _, err := io.Copy(h, tr); err != nil {
+			t.Fatalf("io.Copy: %v", err)
+		}
+		if !bytes.Equal(h.Sum(nil), wantSum[:]) {
+			t.Fatal("large file content does not round-trip through the tar stream")
+		}
+	}
+	if !found {
+		t.Fatal("big.bin entry not found in tar stream")
+	}
+}
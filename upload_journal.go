@@ -0,0 +1,75 @@
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	minio "github.com/minio/minio-go"
+	"github.com/pkg/errors"
+)
+
+// uploadJournal records the in-progress state of a multipart upload so a
+// new Writer for the same key can resume from the last successfully
+// uploaded part instead of restarting from scratch.
+type uploadJournal struct {
+	UploadID string               `json:"upload_id"`
+	Parts    []minio.CompletePart `json:"parts"`
+}
+
+// journalPath returns the on-disk path of the upload journal for key,
+// rooted at dir.
+func journalPath(dir string, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, fmt.Sprintf("%x.upload.json", sum))
+}
+
+// loadJournal reads the journal at path, returning (nil, nil) if no journal
+// exists yet.
+func loadJournal(path string) (*uploadJournal, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not read upload journal")
+	}
+
+	var journal uploadJournal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return nil, errors.Wrap(err, "Could not parse upload journal")
+	}
+
+	return &journal, nil
+}
+
+// saveJournal writes journal to path, creating its parent directory if
+// necessary.
+func saveJournal(path string, journal *uploadJournal) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrap(err, "Could not create upload journal dir")
+	}
+
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return errors.Wrap(err, "Could not encode upload journal")
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return errors.Wrap(err, "Could not write upload journal")
+	}
+
+	return nil
+}
+
+// removeJournal deletes the journal at path once its upload has completed.
+// A missing file is not an error.
+func removeJournal(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "Could not remove upload journal")
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+//go:build linux
+// +build linux
+
+package blobstore
+
+import "syscall"
+
+// xattrPrefix is the PAXRecords key prefix readXattrs/restoreXattrs store
+// extended attributes under, matching GNU tar/libarchive's convention so
+// archives interoperate with those tools.
+const xattrPrefix = "SCHILY.xattr."
+
+// readXattrs returns every extended attribute set on path, keyed by its
+// bare name (without xattrPrefix).
+func readXattrs(path string) (map[string]string, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	namesBuf := make([]byte, size)
+	if _, err := syscall.Listxattr(path, namesBuf); err != nil {
+		return nil, err
+	}
+
+	attrs := make(map[string]string)
+	for _, name := range splitXattrNames(namesBuf) {
+		valSize, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			continue
+		}
+		val := make([]byte, valSize)
+		if valSize > 0 {
+			if _, err := syscall.Getxattr(path, name, val); err != nil {
+				continue
+			}
+		}
+		attrs[name] = string(val)
+	}
+
+	return attrs, nil
+}
+
+// splitXattrNames splits the NUL-separated name list Listxattr fills buf
+// with into individual attribute names.
+func splitXattrNames(buf []byte) []string {
+	var names []string
+	start := 0
+	for i, b := range buf {
+		if b == 0 {
+			if i > start {
+				names = append(names, string(buf[start:i]))
+			}
+			start = i + 1
+		}
+	}
+	return names
+}
+
+// restoreXattr sets a single extended attribute on path, as captured by
+// readXattrs.
+func restoreXattr(path, name, value string) error {
+	return syscall.Setxattr(path, name, []byte(value), 0)
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package blobstore
+
+// xattrPrefix matches xattr_linux.go's, so PAXRecords written on Linux are
+// at least recognized (and skipped) when restoring on another platform.
+const xattrPrefix = "SCHILY.xattr."
+
+// readXattrs is a no-op outside Linux: TarDirOptions.Xattrs has no effect
+// there.
+func readXattrs(path string) (map[string]string, error) {
+	return nil, nil
+}
+
+// restoreXattr is a no-op outside Linux.
+func restoreXattr(path, name, value string) error {
+	return nil
+}